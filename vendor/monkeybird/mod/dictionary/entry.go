@@ -0,0 +1,147 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"encoding/json"
+	"math/rand"
+)
+
+// entry is the value stored for a dictionary key, JSON-encoded into a
+// single log record's Value field. A key is either a regular entry
+// holding one or more Definitions, or an alias, in which case Alias
+// names the key in the same scope whose Definitions it borrows.
+type entry struct {
+	Definitions []string `json:",omitempty"`
+	Mode        string   `json:",omitempty"` // "random", "roundrobin" or "" (= "first")
+	RRIndex     int      `json:",omitempty"` // next index to serve when Mode is "roundrobin"
+	Alias       string   `json:",omitempty"` // non-empty: this key is an alias for Alias
+	Aliases     []string `json:",omitempty"` // keys that alias to this entry
+}
+
+// readEntry decodes the entry stored for key in scope, if any live
+// record exists for it. Callers are expected to hold m.m.
+func (m *module) readEntry(scope, key string) *entry {
+	offset, ok := m.table[scope][key]
+	if !ok {
+		return nil
+	}
+
+	rec, err := m.log.readRecord(offset)
+	if err != nil || rec.Op == opDelete {
+		return nil
+	}
+
+	var e entry
+	if err = json.Unmarshal([]byte(rec.Value), &e); err != nil {
+		return nil
+	}
+
+	return &e
+}
+
+// isLive reports whether key has a current record in scope that is not a
+// delete tombstone. Callers are expected to hold m.m.
+func (m *module) isLive(scope, key string) bool {
+	offset, ok := m.table[scope][key]
+	if !ok {
+		return false
+	}
+
+	rec, err := m.log.readRecord(offset)
+	return err == nil && rec.Op != opDelete
+}
+
+// writeEntry JSON-encodes e and persists it as key's current value in
+// scope. Callers are expected to hold m.m.
+func (m *module) writeEntry(scope, key string, e *entry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	m.append(opSet, scope, key, string(data))
+}
+
+// aliasCycle reports whether aliasing newKey to source, in scope, would
+// create a cycle: aliasing a term to itself, or aliasing to a term that
+// is itself already an alias. Aliases only follow one level of
+// indirection, so the latter would either dead-end resolution or, if it
+// points back to newKey, cycle. Callers are expected to hold m.m.
+func (m *module) aliasCycle(scope, newKey, source string) bool {
+	if newKey == source {
+		return true
+	}
+
+	e := m.readEntry(scope, source)
+	return e != nil && e.Alias != ""
+}
+
+// removeAlias deletes key's own alias record and drops key from the
+// Aliases slice of the entry it pointed to, if that entry is still live.
+// Callers are expected to hold m.m.
+func (m *module) removeAlias(scope, key string, e *entry) {
+	m.append(opDelete, scope, key, "")
+	m.unindexKey(scope, key)
+
+	source := m.readEntry(scope, e.Alias)
+	if source == nil {
+		return
+	}
+
+	for i, k := range source.Aliases {
+		if k == key {
+			source.Aliases = append(source.Aliases[:i], source.Aliases[i+1:]...)
+			break
+		}
+	}
+	m.writeEntry(scope, e.Alias, source)
+}
+
+// resolve looks up key in scope and returns one of its definitions, if
+// any. An alias is followed a single level: if key's entry is itself an
+// alias to another alias, resolution fails rather than chasing further
+// indirection. Callers are expected to hold m.m.
+func (m *module) resolve(scope, key string) (string, bool) {
+	e := m.readEntry(scope, key)
+	if e == nil {
+		return "", false
+	}
+
+	if e.Alias != "" {
+		key = e.Alias
+		e = m.readEntry(scope, key)
+		if e == nil || e.Alias != "" {
+			return "", false
+		}
+	}
+
+	if len(e.Definitions) == 0 {
+		return "", false
+	}
+
+	return m.pick(scope, key, e), true
+}
+
+// pick returns one of e.Definitions according to e.Mode. key and scope
+// identify where e was read from, since a "roundrobin" pick persists its
+// advanced cursor back to the log. Callers are expected to hold m.m.
+func (m *module) pick(scope, key string, e *entry) string {
+	switch e.Mode {
+	case "random":
+		return e.Definitions[rand.Intn(len(e.Definitions))]
+
+	case "roundrobin":
+		i := e.RRIndex % len(e.Definitions)
+		v := e.Definitions[i]
+
+		e.RRIndex = (i + 1) % len(e.Definitions)
+		m.writeEntry(scope, key, e)
+
+		return v
+
+	default:
+		return e.Definitions[0]
+	}
+}
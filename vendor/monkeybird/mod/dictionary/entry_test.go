@@ -0,0 +1,92 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestModule(t *testing.T) *module {
+	log, err := openLog(filepath.Join(t.TempDir(), "dictionary.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &module{
+		log:      log,
+		table:    make(map[string]map[string]int64),
+		counters: make(map[string]map[string]int64),
+	}
+}
+
+// Resolving a roundrobin alias must advance and persist the cursor
+// against the target's own key, leaving the alias record untouched.
+func TestResolveRoundRobinAlias(t *testing.T) {
+	m := newTestModule(t)
+
+	m.writeEntry("#chan", "target", &entry{
+		Definitions: []string{"one", "two"},
+		Mode:        "roundrobin",
+		Aliases:     []string{"al"},
+	})
+	m.writeEntry("#chan", "al", &entry{Alias: "target"})
+
+	if v, ok := m.resolve("#chan", "al"); !ok || v != "one" {
+		t.Fatalf("resolve(al) = %q, %v; want one, true", v, ok)
+	}
+
+	alias := m.readEntry("#chan", "al")
+	if alias == nil || alias.Alias != "target" {
+		t.Fatalf("readEntry(al) = %+v; want unchanged alias to target", alias)
+	}
+
+	target := m.readEntry("#chan", "target")
+	if target == nil || target.RRIndex != 1 {
+		t.Fatalf("readEntry(target) = %+v; want RRIndex advanced to 1", target)
+	}
+}
+
+func TestAliasCycle(t *testing.T) {
+	m := newTestModule(t)
+
+	m.writeEntry("#chan", "target", &entry{Definitions: []string{"x"}})
+	m.writeEntry("#chan", "al", &entry{Alias: "target"})
+
+	if !m.aliasCycle("#chan", "target", "target") {
+		t.Fatal("aliasing a term to itself should be a cycle")
+	}
+	if !m.aliasCycle("#chan", "other", "al") {
+		t.Fatal("aliasing to an existing alias should be a cycle")
+	}
+	if m.aliasCycle("#chan", "other", "target") {
+		t.Fatal("aliasing a fresh key to a non-alias term should not be a cycle")
+	}
+}
+
+func TestRemoveAliasDropsItFromSourceAliasesSlice(t *testing.T) {
+	m := newTestModule(t)
+
+	m.writeEntry("#chan", "target", &entry{
+		Definitions: []string{"x"},
+		Aliases:     []string{"al"},
+	})
+	m.writeEntry("#chan", "al", &entry{Alias: "target"})
+
+	m.removeAlias("#chan", "al", m.readEntry("#chan", "al"))
+
+	if m.isLive("#chan", "al") {
+		t.Fatal("removeAlias left the alias record live")
+	}
+
+	target := m.readEntry("#chan", "target")
+	if target == nil {
+		t.Fatal("removeAlias should not touch the source entry's liveness")
+	}
+	for _, a := range target.Aliases {
+		if a == "al" {
+			t.Fatalf("target.Aliases = %v; still lists the removed alias", target.Aliases)
+		}
+	}
+}
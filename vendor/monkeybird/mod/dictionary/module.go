@@ -15,21 +15,33 @@ import (
 	"monkeybird/tr"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 )
 
+// fallbackNamespace is the shared scope consulted whenever a channel-local
+// lookup misses, letting one bot instance serve multiple channels without
+// every channel having to redefine common terms.
+const fallbackNamespace = "*"
+
 type module struct {
-	m        sync.RWMutex
-	file     string
-	commands *cmd.Set
-	table    map[string]string
+	m              sync.RWMutex
+	log            *dictionaryLog
+	commands       *cmd.Set
+	table          map[string]map[string]int64    // channel -> term -> offset of most recent log record
+	counters       map[string]map[string]int64    // channel -> counter name -> current value
+	trigrams       map[string]map[string][]string // channel -> trigram -> terms containing it; built lazily
+	MaxSuggestions int                             // max "did you mean" candidates per miss
+	MaxDistance    int                             // caps the default edit-distance budget of max(1, len(query)/4); 0 means no cap
 }
 
 // New returns a new dictionary module.
 func New() mod.Module {
 	return &module{
-		table: make(map[string]string),
+		table:    make(map[string]map[string]int64),
+		counters: make(map[string]map[string]int64),
 	}
 }
 
@@ -52,16 +64,53 @@ func (m *module) Load(pb irc.ProtocolBinder, prof irc.Profile) {
 		Add(tr.AddDefineDefinitionName, tr.AddDefineDefinitionDesc, true, cmd.RegAny)
 
 	m.commands.Bind(tr.RemoveDefineName, tr.RemoveDefineDesc, true, m.cmdRemoveDefine).
-		Add(tr.RemoveDefineTermName, tr.RemoveDefineTermDesc, true, cmd.RegAny)
+		Add(tr.RemoveDefineTermName, tr.RemoveDefineTermDesc, true, cmd.RegAny).
+		Add(tr.RemoveDefineIndexName, tr.RemoveDefineIndexDesc, true, cmd.RegAny)
+
+	m.commands.Bind(tr.AliasDefineName, tr.AliasDefineDesc, true, m.cmdAliasDefine).
+		Add(tr.AliasDefineSourceTermName, tr.AliasDefineSourceTermDesc, true, cmd.RegAny).
+		Add(tr.AliasDefineAliasTermName, tr.AliasDefineAliasTermDesc, true, cmd.RegAny)
+
+	m.commands.Bind(tr.DefineModeName, tr.DefineModeDesc, true, m.cmdDefineMode).
+		Add(tr.DefineModeTermName, tr.DefineModeTermDesc, true, cmd.RegAny).
+		Add(tr.DefineModeValueName, tr.DefineModeValueDesc, true, cmd.RegAny)
+
+	m.commands.Bind(tr.DefineListName, tr.DefineListDesc, true, m.cmdDefineList).
+		Add(tr.DefineListScopeName, tr.DefineListScopeDesc, false, cmd.RegAny)
+
+	m.commands.Bind(tr.CounterName, tr.CounterDesc, true, m.cmdCounter).
+		Add(tr.CounterActionName, tr.CounterActionDesc, true, cmd.RegAny).
+		Add(tr.CounterNameName, tr.CounterNameDesc, true, cmd.RegAny)
 
-	m.file = filepath.Join(prof.Root(), "dictionary.dat")
+	root := prof.Root()
+
+	cfg := loadConfig(root)
+	m.MaxSuggestions = cfg.MaxSuggestions
+	m.MaxDistance = cfg.MaxDistance
+
+	m.importLegacy(filepath.Join(root, "dictionary.dat"))
+
+	log, err := openLog(filepath.Join(root, "dictionary.log"))
+	if err != nil {
+		return
+	}
+
+	m.log = log
 	m.load()
+
+	if m.log.Size() >= compactionThreshold {
+		m.compact()
+	}
 }
 
 // Unload cleans up library resources and unbinds commands.
 func (m *module) Unload(pb irc.ProtocolBinder, prof irc.Profile) {
 	m.commands.Clear()
 	pb.Unbind("PRIVMSG", m.onPrivMsg)
+
+	if m.log != nil {
+		m.log.Close()
+	}
 }
 
 func (m *module) Help(w irc.ResponseWriter, r *cmd.Request) {
@@ -73,85 +122,393 @@ func (m *module) onPrivMsg(w irc.ResponseWriter, r *irc.Request) {
 	m.commands.Dispatch(w, r)
 }
 
-// cmdAddDefine allows a user to add a new definition.
+// cmdAddDefine allows a user to add a definition for a term, appending to
+// its existing definitions if any. The term may carry an explicit
+// "#channel:" or "*:" prefix to target a scope other than the channel
+// the command was issued in.
 func (m *module) cmdAddDefine(w irc.ResponseWriter, r *cmd.Request) {
 	m.m.Lock()
 	defer m.m.Unlock()
 
-	key := strings.ToLower(r.String(0))
-	if _, ok := m.table[key]; ok {
-		proto.PrivMsg(w, r.SenderName, tr.AddDefineAllreadyUsed, r.String(0))
+	scope, term := parseScope(r.String(0), r.Target)
+	key := strings.ToLower(term)
+
+	e := m.readEntry(scope, key)
+	if e == nil {
+		e = &entry{}
+		m.indexKey(scope, key)
+	} else if e.Alias != "" {
+		proto.PrivMsg(w, r.SenderName, tr.AddDefineIsAlias, r.String(0))
 		return
 	}
 
-	m.table[key] = r.Remainder(2)
-	m.save()
+	e.Definitions = append(e.Definitions, r.Remainder(2))
+	m.writeEntry(scope, key, e)
 
 	proto.PrivMsg(w, r.SenderName, tr.AddDefineDisplayText, r.String(0))
 }
 
-// cmdRemoveDefine allows a user to remove an existing definition.
+// cmdRemoveDefine allows a user to remove one definition, by index, from
+// a term. The term may carry the same scope prefix as cmdAddDefine. The
+// term itself is removed once its last definition is. If the term is an
+// alias, the index is ignored and the alias itself is removed.
 func (m *module) cmdRemoveDefine(w irc.ResponseWriter, r *cmd.Request) {
 	m.m.Lock()
 	defer m.m.Unlock()
 
-	key := strings.ToLower(r.String(0))
-	if _, ok := m.table[key]; !ok {
+	scope, term := parseScope(r.String(0), r.Target)
+	key := strings.ToLower(term)
+
+	e := m.readEntry(scope, key)
+	if e == nil {
 		proto.PrivMsg(w, r.SenderName, tr.RemoveDefineNotFound, r.String(0))
 		return
 	}
 
-	delete(m.table, key)
-	m.save()
+	if e.Alias != "" {
+		m.removeAlias(scope, key, e)
+		proto.PrivMsg(w, r.SenderName, tr.RemoveDefineDisplayText, r.String(0))
+		return
+	}
+
+	index, err := strconv.Atoi(r.String(1))
+	if err != nil || index < 0 || index >= len(e.Definitions) {
+		proto.PrivMsg(w, r.SenderName, tr.RemoveDefineBadIndex, r.String(1))
+		return
+	}
+
+	e.Definitions = append(e.Definitions[:index], e.Definitions[index+1:]...)
+
+	if len(e.Definitions) == 0 {
+		m.append(opDelete, scope, key, "")
+		m.unindexKey(scope, key)
+	} else {
+		e.RRIndex = 0
+		m.writeEntry(scope, key, e)
+	}
 
 	proto.PrivMsg(w, r.SenderName, tr.RemoveDefineDisplayText, r.String(0))
 }
 
-// cmdDefine yields the definition of a given term, if found.
+// cmdAliasDefine makes newKey resolve to the definitions already held by
+// an existing term, in the same scope as that term. Aliases only follow
+// one level of indirection, so aliasing to an alias is rejected as a
+// cycle.
+func (m *module) cmdAliasDefine(w irc.ResponseWriter, r *cmd.Request) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	scope, sourceTerm := parseScope(r.String(0), r.Target)
+	source := strings.ToLower(sourceTerm)
+	newKey := strings.ToLower(r.String(1))
+
+	if m.aliasCycle(scope, newKey, source) {
+		proto.PrivMsg(w, r.SenderName, tr.AliasDefineCycle, r.String(1))
+		return
+	}
+
+	e := m.readEntry(scope, source)
+	if e == nil {
+		proto.PrivMsg(w, r.SenderName, tr.AliasDefineSourceNotFound, r.String(0))
+		return
+	}
+
+	if m.readEntry(scope, newKey) != nil {
+		proto.PrivMsg(w, r.SenderName, tr.AliasDefineAlreadyUsed, r.String(1))
+		return
+	}
+
+	m.writeEntry(scope, newKey, &entry{Alias: source})
+	m.indexKey(scope, newKey)
+
+	e.Aliases = append(e.Aliases, newKey)
+	m.writeEntry(scope, source, e)
+
+	proto.PrivMsg(w, r.SenderName, tr.AliasDefineDisplayText, r.String(1), r.String(0))
+}
+
+// cmdDefineMode sets how cmdDefine picks among a term's definitions:
+// "first" (the default), "random" or "roundrobin".
+func (m *module) cmdDefineMode(w irc.ResponseWriter, r *cmd.Request) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	scope, term := parseScope(r.String(0), r.Target)
+	key := strings.ToLower(term)
+
+	e := m.readEntry(scope, key)
+	if e == nil || e.Alias != "" {
+		proto.PrivMsg(w, r.SenderName, tr.DefineModeNotFound, r.String(0))
+		return
+	}
+
+	mode := strings.ToLower(r.String(1))
+	switch mode {
+	case "first", "random", "roundrobin":
+	default:
+		proto.PrivMsg(w, r.SenderName, tr.DefineModeUnknown, r.String(1))
+		return
+	}
+
+	if mode == "first" {
+		mode = ""
+	}
+
+	e.Mode = mode
+	e.RRIndex = 0
+	m.writeEntry(scope, key, e)
+
+	proto.PrivMsg(w, r.SenderName, tr.DefineModeDisplayText, r.String(0), r.String(1))
+}
+
+// cmdDefine yields the definition of a given term, if found. The channel
+// the request was issued in is tried first, falling back to the shared
+// fallbackNamespace scope. It takes the write lock rather than a read
+// lock because expanding a {counter:name+N} placeholder mutates state.
 func (m *module) cmdDefine(w irc.ResponseWriter, r *cmd.Request) {
-	m.m.RLock()
-	defer m.m.RUnlock()
+	m.m.Lock()
+	defer m.m.Unlock()
 
 	key := strings.ToLower(r.String(0))
-	v, ok := m.table[key]
+
+	v, ok := m.resolve(r.Target, key)
 	if !ok {
-		proto.PrivMsg(w, r.Target, tr.DefineNotFound, r.SenderName, r.String(0))
+		v, ok = m.resolve(fallbackNamespace, key)
+	}
+
+	if !ok {
+		if suggestions := m.suggest(r.Target, key); len(suggestions) > 0 {
+			proto.PrivMsg(w, r.Target, tr.DefineNotFoundSuggest, r.SenderName, r.String(0), strings.Join(suggestions, ", "))
+		} else {
+			proto.PrivMsg(w, r.Target, tr.DefineNotFound, r.SenderName, r.String(0))
+		}
 		return
 	}
 
+	v = m.expand(r.Target, v, templateVars{
+		Sender: r.SenderName,
+		Target: r.Target,
+		Args:   r.Remainder(1),
+	})
+
 	proto.PrivMsg(w, r.Target, tr.DefineDisplayText, r.SenderName, v)
 }
 
-// load reads dictionary data from a file.
+// cmdCounter implements "!counter reset <name>", clearing a counter back
+// to zero in the channel it was invoked from. Unlike the other admin
+// write commands, name carries no "#channel:"/"*:" scope prefix, so a
+// counter outside the invoking channel cannot currently be reset.
+func (m *module) cmdCounter(w irc.ResponseWriter, r *cmd.Request) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if !strings.EqualFold(r.String(0), "reset") {
+		proto.PrivMsg(w, r.SenderName, tr.CounterUnknownAction, r.String(0))
+		return
+	}
+
+	name := strings.ToLower(r.String(1))
+	m.resetCounter(r.Target, name)
+
+	proto.PrivMsg(w, r.SenderName, tr.CounterResetDisplayText, name)
+}
+
+// cmdDefineList enumerates the terms defined in a scope, defaulting to
+// the channel the command was issued in.
+func (m *module) cmdDefineList(w irc.ResponseWriter, r *cmd.Request) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+
+	scope := r.Target
+	if r.Len() > 0 {
+		scope = r.String(0)
+	}
+
+	keys := m.table[scope]
+
+	names := make([]string, 0, len(keys))
+	for key := range keys {
+		if m.isLive(scope, key) {
+			names = append(names, key)
+		}
+	}
+
+	if len(names) == 0 {
+		proto.PrivMsg(w, r.SenderName, tr.DefineListEmpty, scope)
+		return
+	}
+
+	sort.Strings(names)
+
+	proto.PrivMsg(w, r.SenderName, tr.DefineListDisplayText, scope, strings.Join(names, ", "))
+}
+
+// parseScope splits an optional "#channel:" or "*:" scope prefix off
+// term, defaulting to defaultScope when none is present. A bare "*", with
+// no trailing ":", is not a scope prefix: it is treated as a literal key
+// in defaultScope, the same as any other term without a prefix.
+func parseScope(term, defaultScope string) (scope, key string) {
+	if strings.HasPrefix(term, fallbackNamespace+":") {
+		return fallbackNamespace, term[len(fallbackNamespace)+1:]
+	}
+
+	if strings.HasPrefix(term, "#") {
+		if i := strings.IndexByte(term, ':'); i > 0 {
+			return term[:i], term[i+1:]
+		}
+	}
+
+	return defaultScope, term
+}
+
+// writeLog appends a record to the log and triggers compaction once it
+// has grown past compactionThreshold.
+func (m *module) writeLog(op byte, scope, key, value string) (int64, error) {
+	offset, err := m.log.appendRecord(op, scope, key, value)
+	if err != nil {
+		return 0, err
+	}
+
+	if m.log.Size() >= compactionThreshold {
+		m.compact()
+	}
+
+	return offset, nil
+}
+
+// append writes a definition record to the log and updates the in-memory
+// offset table. The table is updated before any compaction runs, so the
+// new record is carried into the compacted log.
+func (m *module) append(op byte, scope, key, value string) {
+	offset, err := m.log.appendRecord(op, scope, key, value)
+	if err != nil {
+		return
+	}
+
+	keys, ok := m.table[scope]
+	if !ok {
+		keys = make(map[string]int64)
+		m.table[scope] = keys
+	}
+	keys[key] = offset
+
+	if m.log.Size() >= compactionThreshold {
+		m.compact()
+	}
+}
+
+// load replays the log from the start to reconstruct the in-memory
+// offset table and counter values.
 func (m *module) load() error {
-	fd, err := os.Open(m.file)
+	table := make(map[string]map[string]int64)
+	counters := make(map[string]map[string]int64)
+
+	err := m.log.replay(func(rec *record, offset int64) {
+		if rec.Op == opCounterSet {
+			names, ok := counters[rec.Channel]
+			if !ok {
+				names = make(map[string]int64)
+				counters[rec.Channel] = names
+			}
+			names[rec.Key], _ = strconv.ParseInt(rec.Value, 10, 64)
+			return
+		}
+
+		keys, ok := table[rec.Channel]
+		if !ok {
+			keys = make(map[string]int64)
+			table[rec.Channel] = keys
+		}
+		keys[rec.Key] = offset
+	})
 	if err != nil {
 		return err
 	}
 
+	m.table = table
+	m.counters = counters
+	m.trigrams = nil // rebuilt lazily against the new table, if needed
+
+	return nil
+}
+
+// compact discards deleted and superseded records from the log, keeping
+// only the live definitions and current counter values, and swaps in the
+// resulting log file in place.
+func (m *module) compact() {
+	log, err := m.log.compact(m.table, m.counters)
+	if err != nil {
+		return
+	}
+
+	m.log = log
+}
+
+// importLegacy imports a dictionary stored in the gzip'd JSON format used
+// before the append-only log, if one is present at path. Since the legacy
+// format has no notion of channels, every entry is imported into
+// fallbackNamespace, matching its old bot-wide visibility. On success the
+// legacy file is renamed aside so it is not imported again on next load.
+func (m *module) importLegacy(path string) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return
+	}
+
 	defer fd.Close()
 
 	gz, err := gzip.NewReader(fd)
 	if err != nil {
-		return err
+		return
 	}
 
 	defer gz.Close()
 
-	return json.NewDecoder(gz).Decode(&m.table)
+	var table map[string]string
+	if err = json.NewDecoder(gz).Decode(&table); err != nil {
+		return
+	}
+
+	log, err := openLog(filepath.Join(filepath.Dir(path), "dictionary.log"))
+	if err != nil {
+		return
+	}
+
+	for key, value := range table {
+		data, err := json.Marshal(&entry{Definitions: []string{value}})
+		if err != nil {
+			continue
+		}
+		log.appendRecord(opSet, fallbackNamespace, key, string(data))
+	}
+
+	log.Close()
+	os.Rename(path, path+".imported")
 }
 
-// save writes dictionary data to a file.
-func (m *module) save() error {
-	fd, err := os.Create(m.file)
+// config holds tunable fuzzy-suggestion parameters, overridable by an
+// optional dictionary.json file in the profile root.
+type config struct {
+	MaxSuggestions int
+	MaxDistance    int
+}
+
+// defaultMaxSuggestions is used when the profile config does not
+// override MaxSuggestions.
+const defaultMaxSuggestions = 3
+
+// loadConfig reads dictionary.json from root, if present, falling back
+// to defaults for anything it does not set.
+func loadConfig(root string) config {
+	cfg := config{MaxSuggestions: defaultMaxSuggestions}
+
+	fd, err := os.Open(filepath.Join(root, "dictionary.json"))
 	if err != nil {
-		return err
+		return cfg
 	}
 
 	defer fd.Close()
 
-	gz := gzip.NewWriter(fd)
-	defer gz.Close()
-
-	return json.NewEncoder(gz).Encode(m.table)
+	json.NewDecoder(fd).Decode(&cfg)
+	return cfg
 }
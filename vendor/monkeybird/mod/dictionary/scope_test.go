@@ -0,0 +1,27 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import "testing"
+
+func TestParseScope(t *testing.T) {
+	cases := []struct {
+		term, defaultScope string
+		wantScope, wantKey string
+	}{
+		{"foo", "#chan", "#chan", "foo"},
+		{"#other:foo", "#chan", "#other", "foo"},
+		{"*:foo", "#chan", fallbackNamespace, "foo"},
+		{"*", "#chan", "#chan", "*"},
+		{"#noColon", "#chan", "#chan", "#noColon"},
+	}
+
+	for _, c := range cases {
+		scope, key := parseScope(c.term, c.defaultScope)
+		if scope != c.wantScope || key != c.wantKey {
+			t.Errorf("parseScope(%q, %q) = (%q, %q); want (%q, %q)",
+				c.term, c.defaultScope, scope, key, c.wantScope, c.wantKey)
+		}
+	}
+}
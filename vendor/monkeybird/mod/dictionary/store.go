@@ -0,0 +1,239 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strconv"
+)
+
+// Record operation codes stored in the first byte of each log entry.
+const (
+	opSet byte = iota + 1
+	opDelete
+	opCounterSet // Value holds the counter's new absolute integer value.
+)
+
+// recordHeaderLen is the fixed-size portion of each log record: 1 byte op
+// + 4 byte channel length + 4 byte key length + 4 byte value length
+// + 4 byte CRC32.
+const recordHeaderLen = 1 + 4 + 4 + 4 + 4
+
+// compactionThreshold is the log size, in bytes, beyond which Load
+// triggers a compaction pass before the module starts serving requests.
+const compactionThreshold = 4 << 20 // 4 MiB
+
+// record is a single decoded log entry. Channel is the scope the entry
+// belongs to: an IRC channel name, or fallbackNamespace for entries
+// shared across every channel.
+type record struct {
+	Op      byte
+	Channel string
+	Key     string
+	Value   string
+}
+
+// dictionaryLog is an append-only, CRC-protected log of dictionary
+// mutations, Bitcask-style: every write is a single sequential append,
+// and reads are served by seeking to the offset of the most recent
+// record for a key.
+type dictionaryLog struct {
+	path string
+	fd   *os.File
+	size int64
+}
+
+// openLog opens, creating if necessary, the log file at path.
+func openLog(path string) (*dictionaryLog, error) {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+
+	return &dictionaryLog{path: path, fd: fd, size: fi.Size()}, nil
+}
+
+// Close closes the underlying log file.
+func (l *dictionaryLog) Close() error {
+	return l.fd.Close()
+}
+
+// Size returns the current size of the log, in bytes.
+func (l *dictionaryLog) Size() int64 {
+	return l.size
+}
+
+// appendRecord appends a single record to the log and returns the file
+// offset it was written at. Callers are expected to serialize writes
+// themselves; this is not safe for concurrent use.
+func (l *dictionaryLog) appendRecord(op byte, channel, key, value string) (int64, error) {
+	cb, kb, vb := []byte(channel), []byte(key), []byte(value)
+
+	buf := make([]byte, recordHeaderLen+len(cb)+len(kb)+len(vb))
+	buf[0] = op
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(cb)))
+	binary.BigEndian.PutUint32(buf[5:9], uint32(len(kb)))
+	binary.BigEndian.PutUint32(buf[9:13], uint32(len(vb)))
+
+	body := buf[recordHeaderLen:]
+	copy(body, cb)
+	copy(body[len(cb):], kb)
+	copy(body[len(cb)+len(kb):], vb)
+	binary.BigEndian.PutUint32(buf[13:17], crc32.ChecksumIEEE(body))
+
+	offset := l.size
+
+	n, err := l.fd.WriteAt(buf, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = l.fd.Sync(); err != nil {
+		return 0, err
+	}
+
+	l.size += int64(n)
+	return offset, nil
+}
+
+// readRecord reads and CRC-validates the record at the given offset.
+func (l *dictionaryLog) readRecord(offset int64) (*record, error) {
+	header := make([]byte, recordHeaderLen)
+	if _, err := l.fd.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+
+	chanLen := binary.BigEndian.Uint32(header[1:5])
+	keyLen := binary.BigEndian.Uint32(header[5:9])
+	valLen := binary.BigEndian.Uint32(header[9:13])
+	wantCRC := binary.BigEndian.Uint32(header[13:17])
+
+	body := make([]byte, chanLen+keyLen+valLen)
+	if _, err := l.fd.ReadAt(body, offset+recordHeaderLen); err != nil {
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(body) != wantCRC {
+		return nil, fmt.Errorf("dictionary: corrupt record at offset %d", offset)
+	}
+
+	return &record{
+		Op:      header[0],
+		Channel: string(body[:chanLen]),
+		Key:     string(body[chanLen : chanLen+keyLen]),
+		Value:   string(body[chanLen+keyLen:]),
+	}, nil
+}
+
+// replay reads every record in the log from the start, invoking fn for
+// each one in order. It stops at the first truncated or corrupt record,
+// treating the remainder of the file as an incomplete trailing write
+// left behind by a crash mid-append.
+func (l *dictionaryLog) replay(fn func(rec *record, offset int64)) error {
+	var offset int64
+
+	for offset < l.size {
+		rec, err := l.readRecord(offset)
+		if err != nil {
+			break
+		}
+
+		fn(rec, offset)
+		offset += int64(recordHeaderLen + len(rec.Channel) + len(rec.Key) + len(rec.Value))
+	}
+
+	return nil
+}
+
+// compact rewrites the log to contain only the most recent, live record
+// for each channel/key pair in tbl plus the current value of every
+// counter, atomically replacing the log file on disk, and returns the
+// newly opened log. tbl is updated in place with the new offsets.
+func (l *dictionaryLog) compact(tbl map[string]map[string]int64, counters map[string]map[string]int64) (*dictionaryLog, error) {
+	tmpPath := l.path + ".compact"
+
+	// Discard any leftover from an interrupted compaction.
+	os.Remove(tmpPath)
+
+	tmp, err := openLog(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	type loc struct {
+		channel, key string
+		offset       int64
+	}
+
+	newOffsets := make([]loc, 0, len(tbl))
+
+	for channel, keys := range tbl {
+		for key, offset := range keys {
+			rec, err := l.readRecord(offset)
+			if err != nil {
+				tmp.Close()
+				os.Remove(tmpPath)
+				return nil, err
+			}
+
+			if rec.Op == opDelete {
+				continue
+			}
+
+			newOffset, err := tmp.appendRecord(opSet, channel, key, rec.Value)
+			if err != nil {
+				tmp.Close()
+				os.Remove(tmpPath)
+				return nil, err
+			}
+
+			newOffsets = append(newOffsets, loc{channel: channel, key: key, offset: newOffset})
+		}
+	}
+
+	for channel, names := range counters {
+		for name, value := range names {
+			if _, err := tmp.appendRecord(opCounterSet, channel, name, strconv.FormatInt(value, 10)); err != nil {
+				tmp.Close()
+				os.Remove(tmpPath)
+				return nil, err
+			}
+		}
+	}
+
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	if err = os.Rename(tmpPath, l.path); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	l.Close()
+
+	for channel := range tbl {
+		delete(tbl, channel)
+	}
+	for _, loc := range newOffsets {
+		keys, ok := tbl[loc.channel]
+		if !ok {
+			keys = make(map[string]int64)
+			tbl[loc.channel] = keys
+		}
+		keys[loc.key] = loc.offset
+	}
+
+	return openLog(l.path)
+}
@@ -0,0 +1,152 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendAndReadRecord(t *testing.T) {
+	l, err := openLog(filepath.Join(t.TempDir(), "dictionary.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	offset, err := l.appendRecord(opSet, "#chan", "term", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := l.readRecord(offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Op != opSet || rec.Channel != "#chan" || rec.Key != "term" || rec.Value != "value" {
+		t.Fatalf("readRecord = %+v; want {opSet #chan term value}", rec)
+	}
+}
+
+func TestReadRecordDetectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dictionary.log")
+
+	l, err := openLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset, err := l.appendRecord(opSet, "#chan", "term", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// Flip the first byte after the header (the start of the channel name),
+	// so the length fields stay intact but the CRC no longer matches.
+	fd, err := openLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	buf := make([]byte, 1)
+	fd.fd.ReadAt(buf, offset+recordHeaderLen)
+	buf[0] ^= 0xff
+	fd.fd.WriteAt(buf, offset+recordHeaderLen)
+
+	if _, err := fd.readRecord(offset); err == nil {
+		t.Fatal("readRecord succeeded on corrupted record, want an error")
+	}
+}
+
+func TestReplayStopsAtTruncatedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dictionary.log")
+
+	l, err := openLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.appendRecord(opSet, "#chan", "one", "1")
+	l.appendRecord(opSet, "#chan", "two", "2")
+	l.Close()
+
+	// Append a few stray bytes directly to the file, short of a full
+	// record header, simulating a crash partway through an append.
+	raw, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Write([]byte{1, 2, 3})
+	raw.Close()
+
+	fd, err := openLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	var got []string
+	if err := fd.replay(func(rec *record, offset int64) {
+		got = append(got, rec.Key)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 || got[0] != "one" || got[1] != "two" {
+		t.Fatalf("replay saw keys %v; want [one two]", got)
+	}
+}
+
+func TestCompactDropsDeletedAndSupersededRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dictionary.log")
+
+	l, err := openLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.appendRecord(opSet, "#chan", "kept", "old-value")
+	keptOffset, _ := l.appendRecord(opSet, "#chan", "kept", "new-value")
+	l.appendRecord(opSet, "#chan", "removed", "value")
+	removedOffset, _ := l.appendRecord(opDelete, "#chan", "removed", "")
+
+	tbl := map[string]map[string]int64{
+		"#chan": {"kept": keptOffset, "removed": removedOffset},
+	}
+	counters := map[string]map[string]int64{
+		"#chan": {"hits": 3},
+	}
+
+	compacted, err := l.compact(tbl, counters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer compacted.Close()
+
+	if _, ok := tbl["#chan"]["removed"]; ok {
+		t.Fatal("compact left a deleted key in the offset table")
+	}
+
+	rec, err := compacted.readRecord(tbl["#chan"]["kept"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Value != "new-value" {
+		t.Fatalf("compacted value = %q; want new-value", rec.Value)
+	}
+
+	var sawCounter bool
+	compacted.replay(func(rec *record, offset int64) {
+		if rec.Op == opCounterSet && rec.Channel == "#chan" && rec.Key == "hits" && rec.Value == "3" {
+			sawCounter = true
+		}
+	})
+	if !sawCounter {
+		t.Fatal("compact dropped the live counter value")
+	}
+}
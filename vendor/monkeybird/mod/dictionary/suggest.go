@@ -0,0 +1,242 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import "sort"
+
+// trigramIndexThreshold is the combined scope size, in keys, beyond which
+// suggestion lookups are narrowed through the trigram index before the
+// more expensive edit-distance scan.
+const trigramIndexThreshold = 2000
+
+// candidate is a single fuzzy-match candidate, ranked by edit distance
+// to the query term.
+type candidate struct {
+	Key      string
+	Distance int
+}
+
+// suggest returns up to MaxSuggestions keys, drawn from scope and
+// fallbackNamespace, that are close to query by Damerau-Levenshtein
+// distance, ordered by (distance asc, key asc). Callers are expected to
+// hold m.m.
+func (m *module) suggest(scope, query string) []string {
+	budget := len(query) / 4
+	if budget < 1 {
+		budget = 1
+	}
+	if m.MaxDistance > 0 && budget > m.MaxDistance {
+		budget = m.MaxDistance
+	}
+
+	var matches []candidate
+
+	for _, key := range m.candidateKeys(scope, query) {
+		if abs(len(key)-len(query)) > budget {
+			continue
+		}
+
+		if d := damerauLevenshtein(query, key, budget); d <= budget {
+			matches = append(matches, candidate{Key: key, Distance: d})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].Key < matches[j].Key
+	})
+
+	max := m.MaxSuggestions
+	if max <= 0 {
+		max = defaultMaxSuggestions
+	}
+	if len(matches) > max {
+		matches = matches[:max]
+	}
+
+	out := make([]string, len(matches))
+	for i, c := range matches {
+		out[i] = c.Key
+	}
+	return out
+}
+
+// candidateKeys returns the keys worth comparing query against, drawn
+// from scope and fallbackNamespace: every key below trigramIndexThreshold
+// entries, or just those sharing a trigram with query once the combined
+// scope grows past it.
+func (m *module) candidateKeys(scope, query string) []string {
+	if len(m.table[scope])+len(m.table[fallbackNamespace]) <= trigramIndexThreshold {
+		seen := make(map[string]bool)
+		for key := range m.table[scope] {
+			if m.isLive(scope, key) {
+				seen[key] = true
+			}
+		}
+		for key := range m.table[fallbackNamespace] {
+			if m.isLive(fallbackNamespace, key) {
+				seen[key] = true
+			}
+		}
+
+		keys := make([]string, 0, len(seen))
+		for key := range seen {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	m.ensureTrigramIndex(scope)
+
+	seen := make(map[string]bool)
+	for _, tg := range trigrams(query) {
+		for _, key := range m.trigrams[scope][tg] {
+			seen[key] = true
+		}
+		for _, key := range m.trigrams[fallbackNamespace][tg] {
+			seen[key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// ensureTrigramIndex builds the trigram index for scope and
+// fallbackNamespace from the current table, for whichever of the two has
+// not been indexed yet.
+func (m *module) ensureTrigramIndex(scope string) {
+	if m.trigrams == nil {
+		m.trigrams = make(map[string]map[string][]string)
+	}
+
+	for _, s := range [...]string{scope, fallbackNamespace} {
+		if m.trigrams[s] != nil {
+			continue
+		}
+
+		m.trigrams[s] = make(map[string][]string)
+		for key := range m.table[s] {
+			if m.isLive(s, key) {
+				m.indexKey(s, key)
+			}
+		}
+	}
+}
+
+// indexKey adds key to scope's trigram index, if that index is in use.
+func (m *module) indexKey(scope, key string) {
+	if m.trigrams == nil || m.trigrams[scope] == nil {
+		return
+	}
+
+	for _, tg := range trigrams(key) {
+		m.trigrams[scope][tg] = append(m.trigrams[scope][tg], key)
+	}
+}
+
+// unindexKey removes key from scope's trigram index, if that index is in
+// use.
+func (m *module) unindexKey(scope, key string) {
+	if m.trigrams == nil || m.trigrams[scope] == nil {
+		return
+	}
+
+	for _, tg := range trigrams(key) {
+		list := m.trigrams[scope][tg]
+		for i, k := range list {
+			if k == key {
+				m.trigrams[scope][tg] = append(list[:i], list[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// trigrams returns the 3-rune substrings of s, in order and including
+// repeats, used to narrow fuzzy-match candidates before the edit-distance
+// scan. Strings shorter
+// than 3 runes are their own single "trigram".
+func trigrams(s string) []string {
+	r := []rune(s)
+	if len(r) < 3 {
+		return []string{s}
+	}
+
+	out := make([]string, 0, len(r)-2)
+	for i := 0; i+3 <= len(r); i++ {
+		out = append(out, string(r[i:i+3]))
+	}
+	return out
+}
+
+// damerauLevenshtein computes the Damerau-Levenshtein edit distance
+// between a and b. Once a row's minimum exceeds maxDist, it bails out
+// early and returns maxDist+1, since the caller only cares whether the
+// distance is within budget.
+func damerauLevenshtein(a, b string, maxDist int) int {
+	ra, rb := []rune(a), []rune(b)
+	la, lb := len(ra), len(rb)
+
+	d := make([][]int, la+1)
+	for i := range d {
+		d[i] = make([]int, lb+1)
+		d[i][0] = i
+	}
+	for j := 0; j <= lb; j++ {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= la; i++ {
+		rowBest := d[i][0]
+
+		for j := 1; j <= lb; j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			best := min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if t := d[i-2][j-2] + cost; t < best {
+					best = t
+				}
+			}
+
+			d[i][j] = best
+			if best < rowBest {
+				rowBest = best
+			}
+		}
+
+		if rowBest > maxDist {
+			return maxDist + 1
+		}
+	}
+
+	return d[la][lb]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
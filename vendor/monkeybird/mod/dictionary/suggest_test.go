@@ -0,0 +1,93 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSuggestRanksByDistanceThenKey(t *testing.T) {
+	m := newTestModule(t)
+
+	for _, key := range []string{"hello", "help", "hallo", "unrelated"} {
+		m.writeEntry("#chan", key, &entry{Definitions: []string{"x"}})
+	}
+
+	got := m.suggest("#chan", "hullo")
+
+	want := []string{"hallo", "hello"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("suggest(hullo) = %v; want %v", got, want)
+	}
+}
+
+func TestSuggestRespectsMaxSuggestions(t *testing.T) {
+	m := newTestModule(t)
+	m.MaxSuggestions = 1
+
+	// Each of these is a single substitution away from "cats", so all
+	// three are within budget and would be returned without the cap.
+	for _, key := range []string{"bats", "rats", "hats"} {
+		m.writeEntry("#chan", key, &entry{Definitions: []string{"x"}})
+	}
+
+	got := m.suggest("#chan", "cats")
+	if len(got) != 1 {
+		t.Fatalf("suggest returned %d candidates; want 1 (MaxSuggestions)", len(got))
+	}
+}
+
+func TestSuggestFallsBackToFallbackNamespace(t *testing.T) {
+	m := newTestModule(t)
+	m.writeEntry(fallbackNamespace, "global", &entry{Definitions: []string{"x"}})
+
+	got := m.suggest("#chan", "globl")
+	if len(got) != 1 || got[0] != "global" {
+		t.Fatalf("suggest(globl) = %v; want [global] from the fallback namespace", got)
+	}
+}
+
+func TestCandidateKeysUsesTrigramIndexPastThreshold(t *testing.T) {
+	m := newTestModule(t)
+
+	for i := 0; i < trigramIndexThreshold+1; i++ {
+		m.writeEntry("#chan", fmt.Sprintf("term%d", i), &entry{Definitions: []string{"x"}})
+	}
+	m.writeEntry("#chan", "banana", &entry{Definitions: []string{"x"}})
+
+	keys := m.candidateKeys("#chan", "banana")
+
+	var found bool
+	for _, k := range keys {
+		if k == "banana" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("candidateKeys did not surface an exact-trigram-match key once past the flat-scan threshold")
+	}
+	if m.trigrams == nil {
+		t.Fatal("candidateKeys past the threshold did not build the trigram index")
+	}
+}
+
+func TestTrigramsShortStringIsItsOwnTrigram(t *testing.T) {
+	if got := trigrams("ab"); !reflect.DeepEqual(got, []string{"ab"}) {
+		t.Fatalf("trigrams(ab) = %v; want [ab]", got)
+	}
+}
+
+func TestDamerauLevenshteinTransposition(t *testing.T) {
+	if d := damerauLevenshtein("ab", "ba", 5); d != 1 {
+		t.Fatalf("damerauLevenshtein(ab, ba) = %d; want 1 (single transposition)", d)
+	}
+}
+
+func TestDamerauLevenshteinBudgetCutoff(t *testing.T) {
+	if d := damerauLevenshtein("aaaa", "zzzz", 1); d <= 1 {
+		t.Fatalf("damerauLevenshtein with budget 1 = %d; want budget+1 (early exit)", d)
+	}
+}
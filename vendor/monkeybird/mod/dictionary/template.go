@@ -0,0 +1,128 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// maxExpansionLen caps the length of an expanded definition, guarding
+// against abuse through long chains of counter or variable placeholders.
+const maxExpansionLen = 2000
+
+// maxCounterSubstitutions caps the number of {counter:name+N} placeholders
+// processed per expand call. Each one performs a synchronous, fsync'd log
+// append, and cmdDefine's lookup path is not admin-gated, so without this
+// cap a single admin-authored definition could be used by any user to
+// trigger an unbounded number of writes per invocation.
+const maxCounterSubstitutions = 10
+
+// placeholder matches a single {name}, {counter:name} or
+// {counter:name+N} template variable or action embedded in a definition.
+var placeholder = regexp.MustCompile(`\{([a-zA-Z]+)(?::([A-Za-z0-9_-]+)(?:\+(\d+))?)?\}`)
+
+// templateVars is the whitelisted set of variables available to a
+// definition's {sender}, {target} and {args} placeholders.
+type templateVars struct {
+	Sender string
+	Target string
+	Args   string
+}
+
+// expand resolves the {sender}, {target}, {time}, {args} and
+// {counter:name[+N]} placeholders in value, Twitch-bot style. Every
+// placeholder is substituted in a single left-to-right pass with no
+// re-scanning of its own output, so expansion cannot recurse; combined
+// with the maxExpansionLen cap on the result, a malicious definition
+// can't be used to grow a reply without bound. {counter:name+N} is the
+// only placeholder with a side effect: it atomically increments the
+// named counter in scope and substitutes the new value. Since that
+// increment is a synchronous, fsync'd log append and cmdDefine's lookup
+// path is not admin-gated, {counter:name+N} placeholders past
+// maxCounterSubstitutions are left unexpanded rather than processed,
+// capping writes per call regardless of maxExpansionLen.
+func (m *module) expand(scope, value string, vars templateVars) string {
+	substitutions := 0
+
+	out := placeholder.ReplaceAllStringFunc(value, func(match string) string {
+		sub := placeholder.FindStringSubmatch(match)
+		name, arg, deltaStr := sub[1], sub[2], sub[3]
+
+		switch name {
+		case "sender":
+			return vars.Sender
+		case "target":
+			return vars.Target
+		case "args":
+			return vars.Args
+		case "time":
+			return time.Now().UTC().Format("15:04:05 MST")
+		case "counter":
+			if arg == "" {
+				return match
+			}
+
+			if deltaStr == "" {
+				return strconv.FormatInt(m.counterValue(scope, arg), 10)
+			}
+
+			if substitutions >= maxCounterSubstitutions {
+				return match
+			}
+			substitutions++
+
+			delta, err := strconv.ParseInt(deltaStr, 10, 64)
+			if err != nil {
+				return match
+			}
+
+			return strconv.FormatInt(m.incrCounter(scope, arg, delta), 10)
+		default:
+			return match
+		}
+	})
+
+	if len(out) > maxExpansionLen {
+		out = out[:maxExpansionLen]
+	}
+
+	return out
+}
+
+// counterValue returns a counter's current value in scope, without
+// incrementing it. Callers are expected to hold m.m.
+func (m *module) counterValue(scope, name string) int64 {
+	return m.counters[scope][name]
+}
+
+// incrCounter atomically increments a counter in scope by delta,
+// persists its new value to the log, and returns it. Callers are
+// expected to hold m.m.
+func (m *module) incrCounter(scope, name string, delta int64) int64 {
+	names, ok := m.counters[scope]
+	if !ok {
+		names = make(map[string]int64)
+		m.counters[scope] = names
+	}
+
+	names[name] += delta
+	m.writeLog(opCounterSet, scope, name, strconv.FormatInt(names[name], 10))
+
+	return names[name]
+}
+
+// resetCounter sets a counter in scope back to zero. Callers are
+// expected to hold m.m.
+func (m *module) resetCounter(scope, name string) {
+	names, ok := m.counters[scope]
+	if !ok {
+		names = make(map[string]int64)
+		m.counters[scope] = names
+	}
+
+	names[name] = 0
+	m.writeLog(opCounterSet, scope, name, "0")
+}
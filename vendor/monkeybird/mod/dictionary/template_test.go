@@ -0,0 +1,82 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package dictionary
+
+import "testing"
+
+func TestExpandSubstitutesVars(t *testing.T) {
+	m := newTestModule(t)
+
+	got := m.expand("#chan", "hi {sender} in {target}, args: {args}", templateVars{
+		Sender: "alice",
+		Target: "#chan",
+		Args:   "hello",
+	})
+
+	want := "hi alice in #chan, args: hello"
+	if got != want {
+		t.Fatalf("expand = %q; want %q", got, want)
+	}
+}
+
+func TestExpandLeavesUnknownPlaceholderUntouched(t *testing.T) {
+	m := newTestModule(t)
+
+	got := m.expand("#chan", "{nope}", templateVars{})
+	if got != "{nope}" {
+		t.Fatalf("expand = %q; want {nope} left untouched", got)
+	}
+}
+
+func TestExpandCounterReadsWithoutIncrementing(t *testing.T) {
+	m := newTestModule(t)
+	m.incrCounter("#chan", "hits", 5)
+
+	got := m.expand("#chan", "{counter:hits}", templateVars{})
+	if got != "5" {
+		t.Fatalf("expand = %q; want 5", got)
+	}
+	if v := m.counterValue("#chan", "hits"); v != 5 {
+		t.Fatalf("counterValue after a read-only placeholder = %d; want unchanged at 5", v)
+	}
+}
+
+func TestExpandCounterIncrements(t *testing.T) {
+	m := newTestModule(t)
+
+	got := m.expand("#chan", "{counter:hits+3}", templateVars{})
+	if got != "3" {
+		t.Fatalf("expand = %q; want 3", got)
+	}
+
+	got = m.expand("#chan", "{counter:hits+3}", templateVars{})
+	if got != "6" {
+		t.Fatalf("expand on second call = %q; want 6", got)
+	}
+}
+
+func TestExpandCapsCounterSubstitutions(t *testing.T) {
+	m := newTestModule(t)
+
+	value := ""
+	for i := 0; i < maxCounterSubstitutions+5; i++ {
+		value += "{counter:hits+1}"
+	}
+
+	m.expand("#chan", value, templateVars{})
+
+	if v := m.counterValue("#chan", "hits"); v != maxCounterSubstitutions {
+		t.Fatalf("counter value after expand = %d; want capped at %d", v, maxCounterSubstitutions)
+	}
+}
+
+func TestResetCounter(t *testing.T) {
+	m := newTestModule(t)
+	m.incrCounter("#chan", "hits", 5)
+	m.resetCounter("#chan", "hits")
+
+	if v := m.counterValue("#chan", "hits"); v != 0 {
+		t.Fatalf("counterValue after reset = %d; want 0", v)
+	}
+}
@@ -0,0 +1,96 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package tr
+
+// Strings used by the dictionary module's "define" command.
+const (
+	DefineName     = "define"
+	DefineDesc     = "Yields the definition of a given term."
+	DefineTermName = "term"
+	DefineTermDesc = "The term to look up."
+
+	DefineNotFound        = "%s: No definition found for %q."
+	DefineNotFoundSuggest = "%s: No definition found for %q. Did you mean: %s?"
+	DefineDisplayText     = "%s: %s"
+)
+
+// Strings used by the dictionary module's "adddefine" command.
+const (
+	AddDefineName           = "adddefine"
+	AddDefineDesc           = "Adds a definition for a term."
+	AddDefineTermName       = "term"
+	AddDefineTermDesc       = "The term to define."
+	AddDefineDefinitionName = "definition"
+	AddDefineDefinitionDesc = "The definition text."
+
+	AddDefineDisplayText = "Added a definition for %q."
+	AddDefineIsAlias     = "%q is an alias; add the definition to its source term instead."
+)
+
+// Strings used by the dictionary module's "removedefine" command.
+const (
+	RemoveDefineName      = "removedefine"
+	RemoveDefineDesc      = "Removes a definition for a term."
+	RemoveDefineTermName  = "term"
+	RemoveDefineTermDesc  = "The term to remove the definition for."
+	RemoveDefineIndexName = "index"
+	RemoveDefineIndexDesc = "The index, starting at 0, of the definition to remove."
+
+	RemoveDefineNotFound    = "%q is not defined."
+	RemoveDefineBadIndex    = "%q is not a valid definition index."
+	RemoveDefineDisplayText = "Removed the definition for %q."
+)
+
+// Strings used by the dictionary module's "definelist" command.
+const (
+	DefineListName      = "definelist"
+	DefineListDesc      = "Lists the terms defined in a scope."
+	DefineListScopeName = "scope"
+	DefineListScopeDesc = "The channel, or \"*\" for the shared scope, to list; defaults to the current channel."
+
+	DefineListEmpty       = "%s: No terms are defined."
+	DefineListDisplayText = "%s: %s"
+)
+
+// Strings used by the dictionary module's "counter" command.
+const (
+	CounterName       = "counter"
+	CounterDesc       = "Manages named counters usable from {counter:name} placeholders."
+	CounterActionName = "action"
+	CounterActionDesc = "The action to perform; currently only \"reset\" is supported."
+	CounterNameName   = "name"
+	CounterNameDesc   = "The counter to act on."
+
+	CounterUnknownAction    = "Unknown counter action %q."
+	CounterResetDisplayText = "Counter %q has been reset to 0."
+)
+
+// Strings used by the dictionary module's "aliasdefine" command.
+const (
+	AliasDefineName           = "aliasdefine"
+	AliasDefineDesc           = "Makes a term resolve to the definitions of an existing term."
+	AliasDefineSourceTermName = "term"
+	AliasDefineSourceTermDesc = "The existing term to borrow definitions from."
+	AliasDefineAliasTermName  = "alias"
+	AliasDefineAliasTermDesc  = "The new term that should resolve to term's definitions."
+
+	AliasDefineCycle          = "%q would alias to itself or another alias; aliases only follow one level of indirection."
+	AliasDefineSourceNotFound = "%q is not defined."
+	AliasDefineAlreadyUsed    = "%q is already defined."
+	AliasDefineDisplayText    = "%q now aliases %q."
+)
+
+// Strings used by the dictionary module's "definemode" command.
+const (
+	DefineModeName      = "definemode"
+	DefineModeDesc      = "Sets how a term with multiple definitions picks among them."
+	DefineModeTermName  = "term"
+	DefineModeTermDesc  = "The term to set the pick mode for."
+	DefineModeValueName = "mode"
+	DefineModeValueDesc = "The pick mode: \"first\", \"random\" or \"roundrobin\"."
+
+	DefineModeNotFound    = "%q is not defined."
+	DefineModeUnknown     = "Unknown pick mode %q."
+	DefineModeDisplayText = "%q now picks definitions using %q."
+)